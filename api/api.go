@@ -3,20 +3,23 @@ package api
 import (
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
 
+	"github.com/mkrysiak/cyclops-go/authn"
 	"github.com/mkrysiak/cyclops-go/conf"
+	"github.com/mkrysiak/cyclops-go/cors"
 	"github.com/mkrysiak/cyclops-go/hash"
 
 	"github.com/golang/gddo/httputil/header"
 	"github.com/mkrysiak/cyclops-go/models"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -34,27 +37,93 @@ type Api struct {
 	cache          *models.Cache
 	requestStorage *models.RequestStorage
 	projects       *models.SentryProjects
-	ignoredItems   uint64
-	processedItems uint64
+	throttler      models.Throttler
 }
 
 func NewApiRouter(cfg *conf.Config, cache *models.Cache, requestStorage *models.RequestStorage,
 	projects *models.SentryProjects) *mux.Router {
+	throttler, err := models.NewThrottler(cfg, cache)
+	if err != nil {
+		log.Fatalf("Unable to build throttler: %s", err)
+	}
+
 	api := &Api{
 		cfg:            cfg,
 		requestStorage: requestStorage,
 		projects:       projects,
 		cache:          cache,
-		ignoredItems:   0,
+		throttler:      throttler,
 	}
+
+	if cfg.ProjectsConfigPath != "" {
+		projects.WatchReload(cfg.ProjectsConfigPath)
+	}
+
 	r := mux.NewRouter()
-	r.HandleFunc("/api/{projectId:[0-9]+}/store/", api.apiHandler).Methods("POST")
+	r.Use(cors.Middleware(cors.Config{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedMethods: cfg.CORSAllowedMethods,
+		AllowedHeaders: cfg.CORSAllowedHeaders,
+		MaxAge:         cfg.CORSMaxAge,
+	}))
+	r.HandleFunc("/api/{projectId:[0-9]+}/store/", api.apiHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/{projectId:[0-9]+}/envelope/", api.envelopeHandler).Methods("POST", "OPTIONS")
+	// /tunnel implements Sentry SDK's "tunnel" transport: the browser
+	// posts the envelope same-origin, with no {projectId} in the path, so
+	// the project is resolved from the envelope's own dsn instead.
+	r.HandleFunc("/tunnel", api.tunnelHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/healthcheck", api.healthcheckHandler).Methods("GET")
-	//TODO: Restrict access to /stats.  It should not be public.
-	r.HandleFunc("/stats", api.statsHandler).Methods("GET")
+
+	// /stats and /metrics carry operational detail about this proxy, so
+	// unlike the ingest and healthcheck routes above they're gated behind
+	// authn whenever at least one auth provider is configured. With no auth
+	// settings configured they're served without authentication.
+	adminRouter := r.NewRoute().Subrouter()
+	providers, err := buildAuthProviders(cfg)
+	if err != nil {
+		// An operator who configured auth gets a refused startup, not a
+		// silently unauthenticated /stats and /metrics.
+		log.Fatalf("Unable to build admin auth providers: %s", err)
+	}
+	if len(providers) > 0 {
+		adminRouter.Use(authn.Middleware(providers...))
+	}
+	adminRouter.HandleFunc("/stats", api.statsHandler).Methods("GET")
+	adminRouter.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
 	return r
 }
 
+// buildAuthProviders constructs the authn.Provider chain for admin routes
+// from whichever auth settings are configured. Multiple providers can be
+// enabled at once; a request is accepted if any of them succeed. It's an
+// error, not a silent no-op, if a provider that was explicitly configured
+// fails to build - otherwise the admin routes would fail open.
+func buildAuthProviders(cfg *conf.Config) ([]authn.Provider, error) {
+	var providers []authn.Provider
+
+	if cfg.AuthBasicUsername != "" && cfg.AuthBasicPasswordHash != "" {
+		providers = append(providers, &authn.BasicProvider{
+			Username:     cfg.AuthBasicUsername,
+			PasswordHash: []byte(cfg.AuthBasicPasswordHash),
+		})
+	}
+
+	if cfg.AuthBearerToken != "" {
+		providers = append(providers, &authn.BearerProvider{Token: cfg.AuthBearerToken})
+	}
+
+	if cfg.AuthJWKSURL != "" {
+		jwtProvider, err := authn.NewJWTProvider(cfg.AuthJWKSURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize JWT auth provider: %w", err)
+		}
+		providers = append(providers, jwtProvider)
+	}
+
+	return providers, nil
+}
+
 func (a *Api) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 	log.Info(r.RemoteAddr + " " + r.Method + " " + r.URL.Path)
@@ -62,6 +131,7 @@ func (a *Api) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 
 func (a *Api) apiHandler(w http.ResponseWriter, r *http.Request) {
 	logRequest(r)
+	start := time.Now()
 
 	vars := mux.Vars(r)
 	projectId, err := strconv.Atoi(vars["projectId"])
@@ -71,7 +141,8 @@ func (a *Api) apiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !a.projects.IsValidProjectAndPublicKey(projectId, getSentryKeyAndSecret(r).sentry_key) {
+	project, ok := a.projects.Lookup(projectId)
+	if !ok || project.PublicKey != getSentryKeyAndSecret(r).sentry_key {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -95,66 +166,223 @@ func (a *Api) apiHandler(w http.ResponseWriter, r *http.Request) {
 	cacheKey.WriteString(exceptionHash)
 	log.Debugf("Cache Key: %s", cacheKey.String())
 
-	//TODO: Make URL configurable
-	var originUrl bytes.Buffer
-	originUrl.WriteString("http://localhost:2222")
-	originUrl.WriteString(r.RequestURI)
-	log.Debugf("Origin URL: %s", originUrl.String())
+	originUrl := project.Upstream.URL("store/", r.URL.RawQuery)
+	log.Debugf("Origin URL: %s", originUrl)
+
+	requestBodyBytes.WithLabelValues(vars["projectId"]).Observe(float64(len(bodyBytes)))
 
 	// TODO: It's bad practice to return headers that can identify the product that's in use if
 	// this proxy is externally exposed.
-	count := a.validateCache(cacheKey.String())
-	if count > int64(a.cfg.MaxCacheUses) {
-		w.Header().Set("X-CYCLOPS-CACHE-COUNT", strconv.FormatInt(count, 10))
+	decision, err := a.throttler.Throttle(models.ThrottleRequest{ProjectId: projectId, CacheKey: cacheKey.String()})
+	if err != nil {
+		log.Errorf("Throttler error: %s", err)
+	}
+	recordEvent(projectId, string(decision))
+
+	w.Header().Set("X-CYCLOPS-STATUS", string(decision))
+	if decision == models.ThrottleIgnore || decision == models.ThrottleRateLimit {
+		requestDuration.WithLabelValues(vars["projectId"], string(decision)).Observe(time.Since(start).Seconds())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	a.processRequest(r, projectId, originUrl, r.Header, bodyBytes, []string{"error"})
+
+	requestDuration.WithLabelValues(vars["projectId"], string(decision)).Observe(time.Since(start).Seconds())
+	w.WriteHeader(http.StatusNoContent)
+
+}
+
+// envelopeHandler accepts the modern Sentry ingest path. Unlike
+// apiHandler, an envelope can carry several independent items (an event,
+// an attachment, a session, ...), so each item is hashed and throttled on
+// its own: a noisy event can be dropped while a session in the same
+// envelope is still forwarded.
+func (a *Api) envelopeHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	start := time.Now()
+
+	vars := mux.Vars(r)
+	projectId, err := strconv.Atoi(vars["projectId"])
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	bodyBytes, err := getEnvelopeBody(r)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	header, items, err := parseEnvelope(bodyBytes)
+	if err != nil {
+		log.Errorf("Unable to parse envelope: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dsn, err := parseDSN(header.DSN)
+	if err != nil {
+		log.Errorf("Unable to parse envelope dsn: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	xSentryAuth := getSentryKeyAndSecret(r)
+	publicKey := xSentryAuth.sentry_key
+	if publicKey == "" {
+		publicKey = dsn.publicKey
+	}
+
+	project, ok := a.projects.Lookup(projectId)
+	if !ok || dsn.projectId != projectId || project.PublicKey != publicKey {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	a.processEnvelope(w, r, start, projectId, project, header, items, len(bodyBytes))
+}
+
+// tunnelHandler implements Sentry SDK's "tunnel" transport: the SDK posts
+// the envelope same-origin, with no {projectId} in the path, to dodge
+// ad-blockers that target Sentry's ingest domains. The project is instead
+// resolved from the envelope's own dsn and checked against the allow-list
+// in SentryProjects, so this route can't be used as an open relay to an
+// arbitrary upstream.
+func (a *Api) tunnelHandler(w http.ResponseWriter, r *http.Request) {
+	logRequest(r)
+	start := time.Now()
+
+	bodyBytes, err := getEnvelopeBody(r)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	header, items, err := parseEnvelope(bodyBytes)
+	if err != nil {
+		log.Errorf("Unable to parse tunneled envelope: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	dsn, err := parseDSN(header.DSN)
+	if err != nil {
+		log.Errorf("Unable to parse tunneled envelope dsn: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	project, ok := a.projects.Lookup(dsn.projectId)
+	if !ok || project.PublicKey != dsn.publicKey {
+		log.Errorf("Rejecting tunnel request for unknown project %d", dsn.projectId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	a.processEnvelope(w, r, start, dsn.projectId, project, header, items, len(bodyBytes))
+}
+
+// processEnvelope throttles and forwards an already-validated envelope.
+// It's shared by envelopeHandler, which resolves projectId from the URL,
+// and tunnelHandler, which resolves it from the envelope's dsn.
+func (a *Api) processEnvelope(w http.ResponseWriter, r *http.Request, start time.Time, projectId int,
+	project models.SentryProject, header *envelopeHeader, items []*envelopeItem, bodyLen int) {
+
+	projectIdLabel := strconv.Itoa(projectId)
+	originUrl := project.Upstream.URL("envelope/", r.URL.RawQuery)
+
+	requestBodyBytes.WithLabelValues(projectIdLabel).Observe(float64(bodyLen))
+
+	kept := make([]*envelopeItem, 0, len(items))
+	for _, item := range items {
+		itemHash, err := hash.HashForGrouping(item.payload)
+		if err != nil {
+			log.Errorf("Unable to calculate a hash for envelope item: %s", err)
+		}
+
+		var cacheKey bytes.Buffer
+		cacheKey.WriteString(projectIdLabel)
+		cacheKey.WriteString(item.header.Type)
+		cacheKey.WriteString(itemHash)
+
+		decision, err := a.throttler.Throttle(models.ThrottleRequest{ProjectId: projectId, CacheKey: cacheKey.String()})
+		if err != nil {
+			log.Errorf("Throttler error: %s", err)
+		}
+		recordEvent(projectId, string(decision))
+
+		if decision == models.ThrottleIgnore || decision == models.ThrottleRateLimit {
+			continue
+		}
+
+		kept = append(kept, item)
+	}
+
+	if len(kept) == 0 {
 		w.Header().Set("X-CYCLOPS-STATUS", "IGNORED")
-		atomic.AddUint64(&a.ignoredItems, 1)
+		requestDuration.WithLabelValues(projectIdLabel, "IGNORED").Observe(time.Since(start).Seconds())
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	w.Header().Set("X-CYCLOPS-CACHE-COUNT", strconv.FormatInt(count, 10))
-	w.Header().Set("X-CYCLOPS-STATUS", "PROCESSED")
-	atomic.AddUint64(&a.processedItems, 1)
+	filteredBody, err := encodeEnvelope(header, kept)
+	if err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	a.processRequest(r, projectId, originUrl.String(), bodyBytes)
+	// getEnvelopeBody already gunzipped the request, and filteredBody is the
+	// plaintext envelope rebuilt from it, so a gzip Content-Encoding header
+	// copied straight from the original request would lie to the upstream
+	// about how to decode the body. Strip it before forwarding.
+	headers := r.Header.Clone()
+	headers.Del("Content-Encoding")
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("X-CYCLOPS-STATUS", "PROCESSED")
+	a.processRequest(r, projectId, originUrl, headers, filteredBody, categoriesForItems(kept))
 
+	requestDuration.WithLabelValues(projectIdLabel, "PROCESSED").Observe(time.Since(start).Seconds())
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// statsHandler is kept for backwards compatibility with older dashboards;
+// its numbers are derived from the same Prometheus registry /metrics
+// serves rather than tracked independently.
 func (a *Api) statsHandler(w http.ResponseWriter, r *http.Request) {
+	processed := sumEventsByStatus(string(models.ThrottleAllow)) + sumEventsByStatus(string(models.ThrottleSample))
 
 	var stats bytes.Buffer
 	stats.WriteString("Processed Items: ")
-	stats.WriteString(strconv.FormatUint(a.processedItems, 10))
+	stats.WriteString(strconv.FormatFloat(processed, 'f', 0, 64))
 	stats.WriteString("\n")
 	stats.WriteString("Ignored Items: ")
-	stats.WriteString(strconv.FormatUint(a.ignoredItems, 10))
+	stats.WriteString(strconv.FormatFloat(sumEventsByStatus(string(models.ThrottleIgnore)), 'f', 0, 64))
+	stats.WriteString("\n")
+	stats.WriteString("Sampled Items: ")
+	stats.WriteString(strconv.FormatFloat(sumEventsByStatus(string(models.ThrottleSample)), 'f', 0, 64))
+	stats.WriteString("\n")
+	stats.WriteString("Rate Limited Items: ")
+	stats.WriteString(strconv.FormatFloat(sumEventsByStatus(string(models.ThrottleRateLimit)), 'f', 0, 64))
 	w.Write(stats.Bytes())
 }
 
-func (a *Api) validateCache(url string) int64 {
-	var count int64
-	if a.cfg.UrlCacheExpiration > 0 {
-		count, _ = a.cache.Get(url)
-		if count == 0 {
-			a.cache.Set(url, time.Duration(a.cfg.UrlCacheExpiration)*time.Second)
-		}
-		count, _ = a.cache.Incr(url)
-	}
-	return count
-}
-
-func (a *Api) processRequest(r *http.Request, projectId int, originUrl string, body []byte) {
+func (a *Api) processRequest(r *http.Request, projectId int, originUrl string, headers http.Header, body []byte, categories []string) {
 
 	// Headers is a map[string][]string
 
 	m := &models.Message{
 		ProjectId:     projectId,
 		RequestMethod: r.Method,
-		Headers:       r.Header,
+		Headers:       headers,
 		OriginUrl:     originUrl,
 		RequestBody:   body,
+		Categories:    categories,
 	}
 
 	a.requestStorage.Put(projectId, m)
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// parsedDSN holds the pieces of a Sentry DSN that matter for request
+// validation: https://docs.sentry.io/product/sentry-basics/dsn-explainer/
+type parsedDSN struct {
+	publicKey string
+	projectId int
+}
+
+// parseDSN extracts the public key and project id from a Sentry DSN of the
+// form "https://PUBLIC_KEY@host/PROJECT_ID".
+func parseDSN(dsn string) (*parsedDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("dsn %q is missing a public key", dsn)
+	}
+
+	projectId, err := strconv.Atoi(strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("dsn %q has an invalid project id: %w", dsn, err)
+	}
+
+	return &parsedDSN{
+		publicKey: u.User.Username(),
+		projectId: projectId,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package api
+
+import "testing"
+
+func TestParseDSN(t *testing.T) {
+	dsn, err := parseDSN("https://abc123@host/456")
+	if err != nil {
+		t.Fatalf("parseDSN returned an error: %s", err)
+	}
+	if dsn.publicKey != "abc123" {
+		t.Fatalf("unexpected public key: %q", dsn.publicKey)
+	}
+	if dsn.projectId != 456 {
+		t.Fatalf("unexpected project id: %d", dsn.projectId)
+	}
+}
+
+func TestParseDSN_MissingPublicKey(t *testing.T) {
+	if _, err := parseDSN("https://host/456"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestParseDSN_InvalidProjectId(t *testing.T) {
+	cases := []struct {
+		name string
+		dsn  string
+	}{
+		{"non-numeric project id", "https://abc123@host/notanumber"},
+		{"missing project id", "https://abc123@host/"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseDSN(tc.dsn); err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// envelopeHeader is the first line of a Sentry envelope.
+// https://develop.sentry.dev/sdk/envelopes/
+type envelopeHeader struct {
+	DSN     string `json:"dsn"`
+	EventID string `json:"event_id"`
+	SentAt  string `json:"sent_at"`
+}
+
+// envelopeItemHeader precedes each item's payload within an envelope.
+type envelopeItemHeader struct {
+	Type        string `json:"type"`
+	Length      int    `json:"length"`
+	ContentType string `json:"content_type"`
+}
+
+// envelopeItem is a single item header/payload pair.
+type envelopeItem struct {
+	header  envelopeItemHeader
+	payload []byte
+}
+
+// itemTypeCategories maps an envelope item's type to the Sentry rate-limit
+// category it's billed under, per
+// https://develop.sentry.dev/sdk/rate-limiting/#definitions. Item types
+// with no listed mapping are reported under their own name, which is
+// usually a fine guess and never worse than treating the whole envelope
+// as a single unknown category.
+var itemTypeCategories = map[string]string{
+	"event":            "error",
+	"transaction":      "transaction",
+	"session":          "session",
+	"attachment":       "attachment",
+	"client_report":    "internal",
+	"profile":          "profile",
+	"check_in":         "monitor",
+	"replay_event":     "replay",
+	"replay_recording": "replay",
+}
+
+// categoriesForItems returns the distinct rate-limit categories an
+// envelope's items are billed under.
+func categoriesForItems(items []*envelopeItem) []string {
+	seen := make(map[string]bool, len(items))
+	var categories []string
+	for _, item := range items {
+		category, ok := itemTypeCategories[item.header.Type]
+		if !ok {
+			category = item.header.Type
+		}
+		if !seen[category] {
+			seen[category] = true
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// splitLine splits b at its first newline, returning the line (including
+// the newline, if any) and everything after it.
+func splitLine(b []byte) (line, rest []byte) {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i+1], b[i+1:]
+	}
+	return b, nil
+}
+
+// parseEnvelope reads a newline-delimited Sentry envelope: a JSON header
+// line, followed by pairs of (item header line, item payload bytes).
+func parseEnvelope(body []byte) (*envelopeHeader, []*envelopeItem, error) {
+	headerLine, rest := splitLine(body)
+
+	var header envelopeHeader
+	if err := json.Unmarshal(bytes.TrimSpace(headerLine), &header); err != nil {
+		return nil, nil, err
+	}
+
+	var items []*envelopeItem
+	for len(bytes.TrimSpace(rest)) > 0 {
+		itemHeaderLine, afterHeader := splitLine(rest)
+
+		var itemHeader envelopeItemHeader
+		if err := json.Unmarshal(bytes.TrimSpace(itemHeaderLine), &itemHeader); err != nil {
+			return nil, nil, err
+		}
+
+		// itemHeader.Length is attacker-controlled: a negative value would
+		// panic on make([]byte, ...) below, and an oversized one would
+		// allocate far more than the request actually contains.
+		if itemHeader.Length < 0 || itemHeader.Length > len(afterHeader) {
+			return nil, nil, fmt.Errorf("envelope item %q has an invalid length %d", itemHeader.Type, itemHeader.Length)
+		}
+
+		payload := make([]byte, itemHeader.Length)
+		copy(payload, afterHeader[:itemHeader.Length])
+		rest = afterHeader[itemHeader.Length:]
+
+		// Consume the newline separating this item from the next, if any.
+		if len(rest) > 0 && rest[0] == '\n' {
+			rest = rest[1:]
+		}
+
+		items = append(items, &envelopeItem{header: itemHeader, payload: payload})
+	}
+
+	return &header, items, nil
+}
+
+// encodeEnvelope rebuilds a newline-delimited envelope containing only the
+// given items, reusing the original envelope header.
+func encodeEnvelope(header *envelopeHeader, items []*envelopeItem) ([]byte, error) {
+	var buf bytes.Buffer
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(headerBytes)
+	buf.WriteByte('\n')
+
+	for _, item := range items {
+		itemHeaderBytes, err := json.Marshal(item.header)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(itemHeaderBytes)
+		buf.WriteByte('\n')
+		buf.Write(item.payload)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// getEnvelopeBody reads the request body, transparently gunzipping it when
+// the SDK sent Content-Encoding: gzip.
+func getEnvelopeBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return ioutil.ReadAll(gz)
+	}
+	return ioutil.ReadAll(r.Body)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func buildEnvelope(header string, items ...[2]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	buf.WriteByte('\n')
+	for _, item := range items {
+		buf.WriteString(item[0])
+		buf.WriteByte('\n')
+		buf.WriteString(item[1])
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func TestParseEnvelope_MixedItemTypes(t *testing.T) {
+	body := buildEnvelope(
+		`{"event_id":"abc123","dsn":"https://key@host/1"}`,
+		[2]string{`{"type":"event","length":14,"content_type":"application/json"}`, `{"msg":"boom"}`},
+		[2]string{`{"type":"session","length":16,"content_type":"application/json"}`, `{"status":"ok"}a`},
+	)
+
+	header, items, err := parseEnvelope(body)
+	if err != nil {
+		t.Fatalf("parseEnvelope returned an error: %s", err)
+	}
+
+	if header.DSN != "https://key@host/1" {
+		t.Fatalf("unexpected dsn: %q", header.DSN)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	if items[0].header.Type != "event" || string(items[0].payload) != `{"msg":"boom"}` {
+		t.Fatalf("unexpected first item: %+v", items[0])
+	}
+	if items[1].header.Type != "session" || string(items[1].payload) != `{"status":"ok"}a` {
+		t.Fatalf("unexpected second item: %+v", items[1])
+	}
+}
+
+func TestParseEnvelope_RejectsInvalidLength(t *testing.T) {
+	cases := []struct {
+		name   string
+		length string
+	}{
+		{"negative", "-1"},
+		{"longer than remaining body", "9999"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := buildEnvelope(
+				`{"event_id":"abc123"}`,
+				[2]string{`{"type":"event","length":` + tc.length + `}`, `{"msg":"boom"}`},
+			)
+
+			if _, _, err := parseEnvelope(body); err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestEncodeEnvelope_RoundTrip(t *testing.T) {
+	body := buildEnvelope(
+		`{"event_id":"abc123"}`,
+		[2]string{`{"type":"event","length":14,"content_type":"application/json"}`, `{"msg":"boom"}`},
+		[2]string{`{"type":"attachment","length":5,"content_type":"application/octet-stream"}`, `hello`},
+	)
+
+	header, items, err := parseEnvelope(body)
+	if err != nil {
+		t.Fatalf("parseEnvelope returned an error: %s", err)
+	}
+
+	encoded, err := encodeEnvelope(header, items)
+	if err != nil {
+		t.Fatalf("encodeEnvelope returned an error: %s", err)
+	}
+
+	roundTripHeader, roundTripItems, err := parseEnvelope(encoded)
+	if err != nil {
+		t.Fatalf("parseEnvelope of re-encoded envelope returned an error: %s", err)
+	}
+	if roundTripHeader.EventID != header.EventID {
+		t.Fatalf("event id not preserved: got %q, want %q", roundTripHeader.EventID, header.EventID)
+	}
+	if len(roundTripItems) != len(items) {
+		t.Fatalf("expected %d items, got %d", len(items), len(roundTripItems))
+	}
+	for i := range items {
+		if string(roundTripItems[i].payload) != string(items[i].payload) {
+			t.Fatalf("item %d payload not preserved: got %q, want %q", i, roundTripItems[i].payload, items[i].payload)
+		}
+	}
+}
+
+func TestGetEnvelopeBody_Gzip(t *testing.T) {
+	body := buildEnvelope(
+		`{"event_id":"abc123"}`,
+		[2]string{`{"type":"event","length":14}`, `{"msg":"boom"}`},
+	)
+
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	if _, err := gz.Write(body); err != nil {
+		t.Fatalf("unable to gzip test body: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("unable to close gzip writer: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/tunnel", &gzBuf)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	got, err := getEnvelopeBody(req)
+	if err != nil {
+		t.Fatalf("getEnvelopeBody returned an error: %s", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("got %q, want %q", got, body)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// eventsTotal counts every event cyclops-go has seen, broken down by
+	// the project it belongs to and the throttle decision it received.
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cyclops_events_total",
+		Help: "Total number of events handled, labeled by project and status.",
+	}, []string{"project_id", "status"})
+
+	// requestBodyBytes tracks the size of incoming request bodies.
+	requestBodyBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cyclops_request_body_bytes",
+		Help:    "Size, in bytes, of incoming request bodies.",
+		Buckets: prometheus.ExponentialBuckets(128, 4, 8),
+	}, []string{"project_id"})
+
+	// requestDuration tracks end-to-end handler latency.
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cyclops_request_duration_seconds",
+		Help:    "End-to-end handler latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"project_id", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsTotal, requestBodyBytes, requestDuration)
+}
+
+// recordEvent increments the per-project, per-status event counter. It's
+// the single place apiHandler and envelopeHandler report a throttle
+// decision, so /metrics and the legacy /stats endpoint stay consistent.
+func recordEvent(projectId int, status string) {
+	eventsTotal.WithLabelValues(strconv.Itoa(projectId), status).Inc()
+}
+
+// sumEventsByStatus totals eventsTotal across all projects for the given
+// status. It backs the legacy /stats endpoint so its numbers are derived
+// from the same registry /metrics serves rather than tracked separately.
+func sumEventsByStatus(status string) float64 {
+	metricCh := make(chan prometheus.Metric, 64)
+	go func() {
+		eventsTotal.Collect(metricCh)
+		close(metricCh)
+	}()
+
+	var total float64
+	for m := range metricCh {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			continue
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "status" && label.GetValue() == status {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
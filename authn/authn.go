@@ -0,0 +1,42 @@
+// Package authn provides pluggable authentication for admin-facing routes
+// (/stats, /metrics, and anything added alongside them). It deliberately
+// knows nothing about routing - callers wrap the handlers they want
+// protected with Middleware.
+package authn
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Provider authenticates a single request, returning the authenticated
+// principal's name and whether authentication succeeded.
+type Provider interface {
+	Authenticate(r *http.Request) (principal string, ok bool)
+	// Challenge is the value this provider expects in WWW-Authenticate
+	// when authentication fails.
+	Challenge() string
+}
+
+// Middleware builds an http middleware that accepts a request if any of
+// the given providers authenticate it, and otherwise responds 401 with a
+// WWW-Authenticate challenge from the first provider.
+func Middleware(providers ...Provider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range providers {
+				if principal, ok := p.Authenticate(r); ok {
+					log.Infof("%s authenticated as %q", r.URL.Path, principal)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if len(providers) > 0 {
+				w.Header().Set("WWW-Authenticate", providers[0].Challenge())
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package authn
+
+import (
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicProvider authenticates HTTP Basic credentials against a single
+// configured username and bcrypt password hash.
+type BasicProvider struct {
+	Realm        string
+	Username     string
+	PasswordHash []byte
+}
+
+func (p *BasicProvider) Authenticate(r *http.Request) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != p.Username {
+		return "", false
+	}
+
+	if err := bcrypt.CompareHashAndPassword(p.PasswordHash, []byte(password)); err != nil {
+		return "", false
+	}
+
+	return username, true
+}
+
+func (p *BasicProvider) Challenge() string {
+	realm := p.Realm
+	if realm == "" {
+		realm = "cyclops-go"
+	}
+	return `Basic realm="` + realm + `"`
+}
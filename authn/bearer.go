@@ -0,0 +1,37 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerProvider authenticates requests carrying a static, pre-shared
+// bearer token.
+type BearerProvider struct {
+	Realm string
+	Token string
+}
+
+func (p *BearerProvider) Authenticate(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(authHeader, prefix) {
+		return "", false
+	}
+
+	token := strings.TrimPrefix(authHeader, prefix)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) != 1 {
+		return "", false
+	}
+
+	return "bearer", true
+}
+
+func (p *BearerProvider) Challenge() string {
+	realm := p.Realm
+	if realm == "" {
+		realm = "cyclops-go"
+	}
+	return `Bearer realm="` + realm + `"`
+}
@@ -0,0 +1,147 @@
+package conf
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds the runtime configuration for cyclops-go. Values are
+// sourced from the environment so the proxy can be configured the same
+// way whether it's run as a binary or inside a container.
+type Config struct {
+	// MaxCacheUses is how many times an identical request body is allowed
+	// to be forwarded before it's ignored.
+	MaxCacheUses int
+	// UrlCacheExpiration is how long, in seconds, a cache entry lives
+	// before its count resets. A value of 0 disables caching entirely.
+	UrlCacheExpiration int
+
+	RedisAddr  string
+	ListenAddr string
+
+	// ThrottleStrategy selects which models.Throttler implementation
+	// apiHandler uses: "fixed_window" (default), "token_bucket", or
+	// "exponential_decay".
+	ThrottleStrategy string
+	// TokenBucketRatePerSecond is the per-project cap used by the
+	// token_bucket strategy.
+	TokenBucketRatePerSecond int
+	// SampleThreshold is how many times a group must be seen before the
+	// exponential_decay strategy starts sampling it.
+	SampleThreshold int
+	// SampleRate is the 1-in-N rate the exponential_decay strategy keeps
+	// once a group has crossed SampleThreshold.
+	SampleRate int
+
+	// AuthBasicUsername/AuthBasicPasswordHash enable HTTP Basic auth on
+	// admin routes when both are set. The password is a bcrypt hash, not
+	// a plaintext secret.
+	AuthBasicUsername     string
+	AuthBasicPasswordHash string
+	// AuthBearerToken enables static bearer token auth when set.
+	AuthBearerToken string
+	// AuthJWKSURL enables JWT auth, verified against the keys published
+	// at this JWKS URL, when set.
+	AuthJWKSURL string
+
+	// ForwarderWorkers bounds how many messages the forwarder delivers to
+	// the upstream origin concurrently.
+	ForwarderWorkers int
+	// ForwarderMaxRetries bounds how many times the forwarder retries a
+	// single message before spooling it to the dead letter sink.
+	ForwarderMaxRetries int
+	// DeadLetterBackend selects where messages that exhaust their retries
+	// are spooled: "disk" (default) or "redis".
+	DeadLetterBackend string
+	// DeadLetterDir is the spool directory used by the disk dead letter
+	// backend.
+	DeadLetterDir string
+	// DeadLetterRedisKey is the list key used by the redis dead letter
+	// backend.
+	DeadLetterRedisKey string
+
+	// ProjectsConfigPath points at the JSON file describing which
+	// projects this proxy serves and where each one's events are
+	// forwarded. See models.LoadSentryProjects.
+	ProjectsConfigPath string
+
+	// CORSAllowedOrigins enables CORS on the ingest routes when set,
+	// letting browser SDKs (via Sentry's "tunnel" transport) POST
+	// directly to this proxy. Empty disables CORS entirely.
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods and CORSAllowedHeaders are echoed back on a CORS
+	// preflight response.
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	// CORSMaxAge is how long, in seconds, a browser may cache a preflight
+	// response.
+	CORSMaxAge int
+}
+
+// NewConfig builds a Config from the environment, falling back to
+// sensible defaults for anything that isn't set.
+func NewConfig() *Config {
+	return &Config{
+		MaxCacheUses:             getEnvInt("CYCLOPS_MAX_CACHE_USES", 5),
+		UrlCacheExpiration:       getEnvInt("CYCLOPS_URL_CACHE_EXPIRATION", 60),
+		RedisAddr:                getEnv("CYCLOPS_REDIS_ADDR", "localhost:6379"),
+		ListenAddr:               getEnv("CYCLOPS_LISTEN_ADDR", ":8000"),
+		ThrottleStrategy:         getEnv("CYCLOPS_THROTTLE_STRATEGY", "fixed_window"),
+		TokenBucketRatePerSecond: getEnvInt("CYCLOPS_TOKEN_BUCKET_RATE", 100),
+		SampleThreshold:          getEnvInt("CYCLOPS_SAMPLE_THRESHOLD", 1000),
+		SampleRate:               getEnvInt("CYCLOPS_SAMPLE_RATE", 100),
+		AuthBasicUsername:        getEnv("CYCLOPS_AUTH_BASIC_USERNAME", ""),
+		AuthBasicPasswordHash:    getEnv("CYCLOPS_AUTH_BASIC_PASSWORD_HASH", ""),
+		AuthBearerToken:          getEnv("CYCLOPS_AUTH_BEARER_TOKEN", ""),
+		AuthJWKSURL:              getEnv("CYCLOPS_AUTH_JWKS_URL", ""),
+		ForwarderWorkers:         getEnvInt("CYCLOPS_FORWARDER_WORKERS", 10),
+		ForwarderMaxRetries:      getEnvInt("CYCLOPS_FORWARDER_MAX_RETRIES", 5),
+		DeadLetterBackend:        getEnv("CYCLOPS_DEAD_LETTER_BACKEND", "disk"),
+		DeadLetterDir:            getEnv("CYCLOPS_DEAD_LETTER_DIR", "./dead-letter"),
+		DeadLetterRedisKey:       getEnv("CYCLOPS_DEAD_LETTER_REDIS_KEY", "cyclops:dead-letter"),
+		ProjectsConfigPath:       getEnv("CYCLOPS_PROJECTS_CONFIG_PATH", "./projects.json"),
+		CORSAllowedOrigins:       getEnvList("CYCLOPS_CORS_ALLOWED_ORIGINS", ""),
+		CORSAllowedMethods:       getEnvList("CYCLOPS_CORS_ALLOWED_METHODS", "POST, OPTIONS"),
+		CORSAllowedHeaders:       getEnvList("CYCLOPS_CORS_ALLOWED_HEADERS", "Content-Type, X-Sentry-Auth"),
+		CORSMaxAge:               getEnvInt("CYCLOPS_CORS_MAX_AGE", 600),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// getEnvList reads a comma-separated list from the environment, falling
+// back to fallback (also comma-separated) if the variable isn't set. An
+// empty result is returned as nil.
+func getEnvList(key, fallback string) []string {
+	v := getEnv(key, fallback)
+	if v == "" {
+		return nil
+	}
+
+	parts := strings.Split(v, ",")
+	list := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
@@ -0,0 +1,62 @@
+// Package cors adds browser-facing CORS support to the ingest routes, so
+// Sentry's JavaScript SDK can use its "tunnel" transport (a same-origin
+// POST that bypasses ad-blockers) instead of talking to Sentry directly.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Config describes which origins, methods, and headers cyclops-go allows
+// for cross-origin requests.
+type Config struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// MaxAge is how long, in seconds, a browser may cache a preflight
+	// response before sending another OPTIONS request.
+	MaxAge int
+}
+
+// Middleware builds an http middleware that answers CORS preflight
+// (OPTIONS) requests and adds the Access-Control-Allow-Origin header to
+// actual requests from an allowed origin. Routes that should be
+// reachable cross-origin must also accept the OPTIONS method, since
+// gorilla/mux won't route a preflight request to this middleware
+// otherwise.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin != "" && cfg.allowsOrigin(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Vary", "Origin")
+			}
+
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (cfg Config) allowsOrigin(origin string) bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
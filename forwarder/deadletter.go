@@ -0,0 +1,52 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mkrysiak/cyclops-go/models"
+)
+
+// DeadLetterSink receives messages that exhausted their retry budget
+// without being delivered upstream.
+type DeadLetterSink interface {
+	Spool(m *models.Message) error
+}
+
+// DiskDeadLetterSink writes failed messages as JSON files under Dir so an
+// operator can inspect or replay them later.
+type DiskDeadLetterSink struct {
+	Dir string
+}
+
+func (s *DiskDeadLetterSink) Spool(m *models.Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%d.json", m.ProjectId, time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(s.Dir, name), data, 0o644)
+}
+
+// RedisDeadLetterSink pushes failed messages onto a Redis list so an
+// operator-run sweep process can drain and replay them.
+type RedisDeadLetterSink struct {
+	Cache *models.Cache
+	Key   string
+}
+
+func (s *RedisDeadLetterSink) Spool(m *models.Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.Cache.RPush(s.Key, data)
+}
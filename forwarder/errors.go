@@ -0,0 +1,14 @@
+package forwarder
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errRateLimited = errors.New("forwarder: rate limited by upstream")
+
+type errUpstream int
+
+func (e errUpstream) Error() string {
+	return fmt.Sprintf("forwarder: upstream returned status %d", int(e))
+}
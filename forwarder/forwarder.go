@@ -0,0 +1,157 @@
+// Package forwarder delivers queued messages to their upstream Sentry
+// origin, retrying transient failures with backoff and spooling anything
+// that never makes it to a dead letter sink.
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/mkrysiak/cyclops-go/conf"
+	"github.com/mkrysiak/cyclops-go/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewFromConfig builds a Forwarder and its dead letter sink from cfg.
+func NewFromConfig(cfg *conf.Config, storage *models.RequestStorage, cache *models.Cache) (*Forwarder, error) {
+	var deadLetter DeadLetterSink
+	switch cfg.DeadLetterBackend {
+	case "redis":
+		deadLetter = &RedisDeadLetterSink{Cache: cache, Key: cfg.DeadLetterRedisKey}
+	case "", "disk":
+		deadLetter = &DiskDeadLetterSink{Dir: cfg.DeadLetterDir}
+	default:
+		return nil, fmt.Errorf("unknown dead letter backend %q", cfg.DeadLetterBackend)
+	}
+
+	return New(storage, deadLetter, cfg.ForwarderWorkers, uint64(cfg.ForwarderMaxRetries)), nil
+}
+
+// Forwarder pulls messages off a models.RequestStorage queue with a
+// bounded pool of workers and POSTs them to their OriginUrl.
+type Forwarder struct {
+	storage    *models.RequestStorage
+	client     *http.Client
+	workers    int
+	maxRetries uint64
+	deadLetter DeadLetterSink
+
+	active int64
+}
+
+// New builds a Forwarder. workers bounds how many deliveries run
+// concurrently; maxRetries bounds how many times a single message is
+// retried before it's handed to deadLetter.
+func New(storage *models.RequestStorage, deadLetter DeadLetterSink, workers int, maxRetries uint64) *Forwarder {
+	return &Forwarder{
+		storage:    storage,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		workers:    workers,
+		maxRetries: maxRetries,
+		deadLetter: deadLetter,
+	}
+}
+
+// Run starts the worker pool. It blocks until ctx is canceled.
+func (f *Forwarder) Run(ctx context.Context) {
+	for i := 0; i < f.workers; i++ {
+		go f.worker(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (f *Forwarder) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-f.storage.Messages():
+			if !ok {
+				return
+			}
+			f.storage.RecordDequeue()
+			atomic.AddInt64(&f.active, 1)
+			poolDepth.Set(float64(atomic.LoadInt64(&f.active)))
+			f.deliver(m)
+			atomic.AddInt64(&f.active, -1)
+			poolDepth.Set(float64(atomic.LoadInt64(&f.active)))
+		}
+	}
+}
+
+func (f *Forwarder) deliver(m *models.Message) {
+	projectId := strconv.Itoa(m.ProjectId)
+
+	attempt := 0
+	operation := func() error {
+		attempt++
+		if attempt > 1 {
+			retriesTotal.WithLabelValues(projectId).Inc()
+		}
+
+		req, err := http.NewRequest(m.RequestMethod, m.OriginUrl, bytes.NewReader(m.RequestBody))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header = m.Headers.Clone()
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait := retryAfterFromResponse(resp, m.Categories)
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+			return errRateLimited
+		case resp.StatusCode >= 500:
+			return errUpstream(resp.StatusCode)
+		case resp.StatusCode >= 400:
+			// Sentry rejected the payload outright; retrying won't help.
+			return backoff.Permanent(errUpstream(resp.StatusCode))
+		}
+		return nil
+	}
+
+	policy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), f.maxRetries)
+	if err := backoff.Retry(operation, policy); err != nil {
+		log.Errorf("Giving up forwarding message for project %d after %d attempts: %s", m.ProjectId, attempt, err)
+		deliveryTotal.WithLabelValues(projectId, "errored").Inc()
+		deadLetteredTotal.WithLabelValues(projectId).Inc()
+		if spoolErr := f.deadLetter.Spool(m); spoolErr != nil {
+			log.Errorf("Unable to spool dead letter for project %d: %s", m.ProjectId, spoolErr)
+		}
+		return
+	}
+	deliveryTotal.WithLabelValues(projectId, "forwarded").Inc()
+}
+
+// retryAfterFromResponse prefers the most specific cooldown a 429
+// response gives us: X-Sentry-Rate-Limits' per-category tuples that
+// actually apply to categories, falling back to the plain Retry-After
+// header.
+func retryAfterFromResponse(resp *http.Response, categories []string) time.Duration {
+	if raw := resp.Header.Get("X-Sentry-Rate-Limits"); raw != "" {
+		if wait := longestRetryAfter(parseRateLimits(raw), categories); wait > 0 {
+			return wait
+		}
+	}
+
+	if raw := resp.Header.Get("Retry-After"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return 0
+}
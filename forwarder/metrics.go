@@ -0,0 +1,29 @@
+package forwarder
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	poolDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cyclops_forwarder_pool_depth",
+		Help: "Number of worker goroutines currently delivering a message upstream.",
+	})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cyclops_forwarder_retries_total",
+		Help: "Total number of delivery retries, labeled by project.",
+	}, []string{"project_id"})
+
+	deadLetteredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cyclops_forwarder_dead_lettered_total",
+		Help: "Total number of messages that exhausted retries and were spooled to the dead letter sink.",
+	}, []string{"project_id"})
+
+	deliveryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cyclops_forwarder_delivery_total",
+		Help: "Total number of delivery attempts that reached a final outcome, labeled by project and status (forwarded or errored).",
+	}, []string{"project_id", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(poolDepth, retriesTotal, deadLetteredTotal, deliveryTotal)
+}
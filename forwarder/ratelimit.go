@@ -0,0 +1,86 @@
+package forwarder
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimit is a single tuple from Sentry's X-Sentry-Rate-Limits header:
+// https://develop.sentry.dev/sdk/rate-limiting/#definitions
+type rateLimit struct {
+	retryAfter time.Duration
+	categories []string
+	scope      string
+}
+
+// parseRateLimits parses the (possibly multi-valued, comma-separated)
+// X-Sentry-Rate-Limits header into its component tuples.
+func parseRateLimits(header string) []rateLimit {
+	var limits []rateLimit
+
+	for _, tuple := range strings.Split(header, ",") {
+		tuple = strings.TrimSpace(tuple)
+		if tuple == "" {
+			continue
+		}
+
+		parts := strings.Split(tuple, ":")
+		if len(parts) == 0 {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			continue
+		}
+
+		limit := rateLimit{retryAfter: time.Duration(seconds) * time.Second}
+		if len(parts) > 1 && parts[1] != "" {
+			for _, c := range strings.Split(parts[1], ";") {
+				limit.categories = append(limit.categories, strings.TrimSpace(c))
+			}
+		}
+		if len(parts) > 2 {
+			limit.scope = strings.TrimSpace(parts[2])
+		}
+
+		limits = append(limits, limit)
+	}
+
+	return limits
+}
+
+// appliesTo reports whether a rate limit tuple covers any of the given
+// categories. A tuple with no categories listed applies to everything, per
+// https://develop.sentry.dev/sdk/rate-limiting/#definitions.
+func (l rateLimit) appliesTo(categories []string) bool {
+	if len(l.categories) == 0 {
+		return true
+	}
+	for _, c := range l.categories {
+		for _, want := range categories {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// longestRetryAfter returns the longest cooldown among the parsed rate
+// limit tuples that apply to categories, or 0 if none do. A Message is
+// retried as a single HTTP request even though it may bundle several
+// envelope item types, so this still backs off the whole message rather
+// than individual items - but a tuple scoped to a category the message
+// doesn't carry (e.g. a "session" cooldown on a message with only "error"
+// items) is correctly ignored instead of delaying unrelated traffic.
+func longestRetryAfter(limits []rateLimit, categories []string) time.Duration {
+	var longest time.Duration
+	for _, l := range limits {
+		if l.retryAfter > longest && l.appliesTo(categories) {
+			longest = l.retryAfter
+		}
+	}
+	return longest
+}
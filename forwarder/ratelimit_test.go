@@ -0,0 +1,138 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   []rateLimit
+	}{
+		{
+			name:   "single tuple with categories and scope",
+			header: "60:error;transaction:key",
+			want: []rateLimit{
+				{retryAfter: 60 * time.Second, categories: []string{"error", "transaction"}, scope: "key"},
+			},
+		},
+		{
+			name:   "multiple comma separated tuples",
+			header: "60:session:key, 5:error:organization",
+			want: []rateLimit{
+				{retryAfter: 60 * time.Second, categories: []string{"session"}, scope: "key"},
+				{retryAfter: 5 * time.Second, categories: []string{"error"}, scope: "organization"},
+			},
+		},
+		{
+			name:   "no categories applies to everything",
+			header: "10::key",
+			want: []rateLimit{
+				{retryAfter: 10 * time.Second, scope: "key"},
+			},
+		},
+		{
+			name:   "no scope",
+			header: "10:error",
+			want: []rateLimit{
+				{retryAfter: 10 * time.Second, categories: []string{"error"}},
+			},
+		},
+		{
+			name:   "blank entries are skipped",
+			header: " , 10:error:key, ",
+			want: []rateLimit{
+				{retryAfter: 10 * time.Second, categories: []string{"error"}, scope: "key"},
+			},
+		},
+		{
+			name:   "non-numeric retry-after is skipped",
+			header: "notanumber:error:key",
+			want:   nil,
+		},
+		{
+			name:   "empty header",
+			header: "",
+			want:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseRateLimits(tc.header)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d tuples, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i := range got {
+				if got[i].retryAfter != tc.want[i].retryAfter || got[i].scope != tc.want[i].scope ||
+					!stringSlicesEqual(got[i].categories, tc.want[i].categories) {
+					t.Fatalf("tuple %d: got %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRateLimitAppliesTo(t *testing.T) {
+	cases := []struct {
+		name       string
+		limit      rateLimit
+		categories []string
+		want       bool
+	}{
+		{"unscoped applies to anything", rateLimit{}, []string{"error"}, true},
+		{"matching category", rateLimit{categories: []string{"error", "transaction"}}, []string{"error"}, true},
+		{"no overlap", rateLimit{categories: []string{"session"}}, []string{"error"}, false},
+		{"no categories requested", rateLimit{categories: []string{"session"}}, nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.limit.appliesTo(tc.categories); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLongestRetryAfter(t *testing.T) {
+	limits := []rateLimit{
+		{retryAfter: 60 * time.Second, categories: []string{"session"}},
+		{retryAfter: 5 * time.Second, categories: []string{"error"}},
+		{retryAfter: 30 * time.Second, categories: []string{"error", "transaction"}},
+	}
+
+	cases := []struct {
+		name       string
+		limits     []rateLimit
+		categories []string
+		want       time.Duration
+	}{
+		{"picks the longest among matching categories", limits, []string{"error"}, 30 * time.Second},
+		{"unrelated category is ignored", limits, []string{"attachment"}, 0},
+		{"unscoped tuple always applies", []rateLimit{{retryAfter: 10 * time.Second}}, []string{"anything"}, 10 * time.Second},
+		{"no tuples", nil, []string{"error"}, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := longestRetryAfter(tc.limits, tc.categories); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Package hash computes stable grouping hashes for Sentry event payloads so
+// that repeated occurrences of the same error can be recognized regardless
+// of volatile fields like timestamps or event ids.
+package hash
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// volatileFields are stripped out before hashing because they change on
+// every occurrence of an otherwise identical event.
+var volatileFields = []string{"event_id", "timestamp", "sent_at", "server_name"}
+
+// HashForGrouping returns a stable, hex-encoded SHA1 hash for a Sentry
+// event body. Two payloads that only differ in their volatile fields will
+// hash to the same value.
+func HashForGrouping(body []byte) (string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		// Not JSON (or not an object) - fall back to hashing the raw body
+		// so we still get a usable cache key.
+		return hashBytes(body), nil
+	}
+
+	for _, field := range volatileFields {
+		delete(payload, field)
+	}
+
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return hashBytes(normalized), nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
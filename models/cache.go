@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/net/context"
+)
+
+// Cache is a thin wrapper around Redis used to count how many times a
+// given key (typically a project id + grouping hash) has been seen within
+// a TTL window.
+type Cache struct {
+	client *redis.Client
+}
+
+// NewCache connects to the Redis instance at addr.
+func NewCache(addr string) *Cache {
+	return &Cache{
+		client: redis.NewClient(&redis.Options{
+			Addr: addr,
+		}),
+	}
+}
+
+// Get returns the current count stored for key, or 0 if it doesn't exist.
+func (c *Cache) Get(key string) (int64, error) {
+	val, err := c.client.Get(context.Background(), key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return val, err
+}
+
+// Set initializes key to 0 with the given expiration. It's a no-op if the
+// key already exists.
+func (c *Cache) Set(key string, expiration time.Duration) error {
+	return c.client.SetNX(context.Background(), key, 0, expiration).Err()
+}
+
+// Incr atomically increments key and returns the new value.
+func (c *Cache) Incr(key string) (int64, error) {
+	return c.client.Incr(context.Background(), key).Result()
+}
+
+// RPush appends value to the list stored at key, creating it if needed.
+func (c *Cache) RPush(key string, value []byte) error {
+	return c.client.RPush(context.Background(), key, value).Err()
+}
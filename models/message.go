@@ -0,0 +1,17 @@
+package models
+
+import "net/http"
+
+// Message is a single request destined for the upstream Sentry origin.
+// RequestStorage queues Messages for the forwarder to deliver.
+type Message struct {
+	ProjectId     int
+	RequestMethod string
+	Headers       http.Header
+	OriginUrl     string
+	RequestBody   []byte
+	// Categories lists the Sentry rate-limit categories (e.g. "error",
+	// "session") this message carries, so the forwarder can tell whether
+	// a 429's per-category cooldown actually applies to it.
+	Categories []string
+}
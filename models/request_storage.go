@@ -0,0 +1,56 @@
+package models
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// requestStorageDepth reflects how many messages are currently queued
+// waiting to be forwarded upstream. It's owned here, rather than by
+// whatever happens to call Put: Put updates it on every enqueue, while a
+// dequeue through Messages() is reflected only once the receiver calls
+// RecordDequeue.
+var requestStorageDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "cyclops_request_storage_depth",
+	Help: "Number of messages currently queued in RequestStorage.",
+})
+
+func init() {
+	prometheus.MustRegister(requestStorageDepth)
+}
+
+// RequestStorage queues Messages between the API handlers and whatever is
+// responsible for delivering them upstream.
+type RequestStorage struct {
+	queue chan *Message
+}
+
+// NewRequestStorage creates a RequestStorage backed by a buffered channel
+// of the given size.
+func NewRequestStorage(bufferSize int) *RequestStorage {
+	return &RequestStorage{
+		queue: make(chan *Message, bufferSize),
+	}
+}
+
+// Put enqueues m for projectId, overwriting m.ProjectId with projectId.
+func (rs *RequestStorage) Put(projectId int, m *Message) {
+	m.ProjectId = projectId
+	rs.queue <- m
+	requestStorageDepth.Set(float64(len(rs.queue)))
+}
+
+// Messages returns the channel Messages are delivered on.
+func (rs *RequestStorage) Messages() <-chan *Message {
+	return rs.queue
+}
+
+// RecordDequeue reflects a message having been pulled off the queue in
+// the depth gauge. Callers that receive off Messages() directly (rather
+// than through a method on RequestStorage) are responsible for calling
+// this themselves.
+func (rs *RequestStorage) RecordDequeue() {
+	requestStorageDepth.Set(float64(len(rs.queue)))
+}
+
+// Len reports how many messages are currently queued.
+func (rs *RequestStorage) Len() int {
+	return len(rs.queue)
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UpstreamOrigin is the Sentry (or Sentry-compatible) instance a
+// project's events should be relayed to.
+type UpstreamOrigin struct {
+	Scheme    string `json:"scheme"`
+	Host      string `json:"host"`
+	ProjectID int    `json:"project_id"`
+}
+
+// URL builds the full upstream URL for an ingest request, e.g.
+// "https://upstream.example.com/api/456/envelope/?sentry_key=...".
+func (u UpstreamOrigin) URL(itemPath, rawQuery string) string {
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	url := scheme + "://" + u.Host + "/api/" + strconv.Itoa(u.ProjectID) + "/" + itemPath
+	if rawQuery != "" {
+		url += "?" + rawQuery
+	}
+	return url
+}
+
+// SentryProject describes a single project cyclops-go proxies for, and
+// where its events should ultimately be delivered.
+type SentryProject struct {
+	ID        int            `json:"id"`
+	PublicKey string         `json:"public_key"`
+	SecretKey string         `json:"secret_key"`
+	Upstream  UpstreamOrigin `json:"upstream"`
+}
+
+// SentryProjects is a concurrency-safe lookup of the projects this proxy
+// is configured to accept traffic for. If a default project is set, any
+// project id without an explicit entry is routed there instead of being
+// rejected, making cyclops-go usable as a catch-all relay.
+type SentryProjects struct {
+	mu             sync.RWMutex
+	projects       map[int]SentryProject
+	defaultProject *SentryProject
+}
+
+// NewSentryProjects builds a SentryProjects lookup from a list of
+// projects and an optional wildcard default.
+func NewSentryProjects(projects []SentryProject, defaultProject *SentryProject) *SentryProjects {
+	sp := &SentryProjects{}
+	sp.replace(projects, defaultProject)
+	return sp
+}
+
+// sentryProjectsFile is the on-disk shape read by LoadSentryProjects and
+// Reload: a list of explicitly configured projects plus an optional
+// wildcard default.
+type sentryProjectsFile struct {
+	Projects []SentryProject `json:"projects"`
+	Default  *SentryProject  `json:"default"`
+}
+
+func readSentryProjectsFile(path string) (sentryProjectsFile, error) {
+	var config sentryProjectsFile
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// LoadSentryProjects reads a JSON file of the form
+// {"projects": [...], "default": {...}} and builds a SentryProjects from
+// it. "default" may be omitted.
+func LoadSentryProjects(path string) (*SentryProjects, error) {
+	config, err := readSentryProjectsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSentryProjects(config.Projects, config.Default), nil
+}
+
+func (sp *SentryProjects) replace(projects []SentryProject, defaultProject *SentryProject) {
+	byId := make(map[int]SentryProject, len(projects))
+	for _, p := range projects {
+		byId[p.ID] = p
+	}
+
+	sp.mu.Lock()
+	sp.projects = byId
+	sp.defaultProject = defaultProject
+	sp.mu.Unlock()
+}
+
+// Reload replaces the project list in place by re-reading path, so
+// operators can add projects without restarting the proxy (see
+// WatchReload).
+func (sp *SentryProjects) Reload(path string) error {
+	config, err := readSentryProjectsFile(path)
+	if err != nil {
+		return err
+	}
+	sp.replace(config.Projects, config.Default)
+	return nil
+}
+
+// WatchReload reloads the project list from path every time the process
+// receives SIGHUP.
+func (sp *SentryProjects) WatchReload(path string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for range sighup {
+			if err := sp.Reload(path); err != nil {
+				log.Errorf("Unable to reload sentry projects from %s: %s", path, err)
+				continue
+			}
+			log.Infof("Reloaded sentry projects from %s", path)
+		}
+	}()
+}
+
+// Lookup returns the project registered for projectId, falling back to
+// the configured default project (if any) when there's no explicit
+// entry. The bool return indicates whether projectId is being served at
+// all, explicitly or via the default.
+func (sp *SentryProjects) Lookup(projectId int) (SentryProject, bool) {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	if p, ok := sp.projects[projectId]; ok {
+		return p, true
+	}
+	if sp.defaultProject != nil {
+		return *sp.defaultProject, true
+	}
+	return SentryProject{}, false
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ThrottleDecision is the outcome of running a request through a
+// Throttler.
+type ThrottleDecision string
+
+const (
+	// ThrottleAllow means the request should be forwarded as-is.
+	ThrottleAllow ThrottleDecision = "PROCESSED"
+	// ThrottleIgnore means the request matched an existing group too many
+	// times and should be dropped.
+	ThrottleIgnore ThrottleDecision = "IGNORED"
+	// ThrottleSample means the request was forwarded, but only because it
+	// was chosen by a sampler rather than allowed outright.
+	ThrottleSample ThrottleDecision = "SAMPLED"
+	// ThrottleRateLimit means the request was dropped because its project
+	// exceeded its overall rate limit, independent of grouping.
+	ThrottleRateLimit ThrottleDecision = "RATE_LIMITED"
+)
+
+// ThrottleRequest carries whatever a Throttler implementation might need
+// to reach a decision. Not every field is used by every strategy.
+type ThrottleRequest struct {
+	ProjectId int
+	// CacheKey identifies the group this request belongs to, e.g. a
+	// project id plus an item's grouping hash.
+	CacheKey string
+}
+
+// Throttler decides whether a request should be forwarded, sampled,
+// ignored, or rate limited. Strategies are selected via conf.Config and
+// are interchangeable at the call site in apiHandler/envelopeHandler.
+type Throttler interface {
+	Throttle(req ThrottleRequest) (ThrottleDecision, error)
+}
+
+// ThrottleStrategy names a Throttler implementation.
+type ThrottleStrategy string
+
+const (
+	ThrottleStrategyFixedWindow      ThrottleStrategy = "fixed_window"
+	ThrottleStrategyTokenBucket      ThrottleStrategy = "token_bucket"
+	ThrottleStrategyExponentialDecay ThrottleStrategy = "exponential_decay"
+)
+
+// FixedWindowThrottler drops a group once it's been seen more than
+// MaxUses times within the cache's TTL window. This is the original
+// validateCache behavior.
+type FixedWindowThrottler struct {
+	Cache              *Cache
+	MaxUses            int64
+	UrlCacheExpiration time.Duration
+}
+
+func (t *FixedWindowThrottler) Throttle(req ThrottleRequest) (ThrottleDecision, error) {
+	if t.UrlCacheExpiration <= 0 {
+		return ThrottleAllow, nil
+	}
+
+	count, err := t.Cache.Get(req.CacheKey)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+	if count == 0 {
+		if err := t.Cache.Set(req.CacheKey, t.UrlCacheExpiration); err != nil {
+			return ThrottleAllow, err
+		}
+	}
+
+	count, err = t.Cache.Incr(req.CacheKey)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+
+	if count > t.MaxUses {
+		return ThrottleIgnore, nil
+	}
+	return ThrottleAllow, nil
+}
+
+// TokenBucketThrottler caps each project at RatePerSecond events/sec
+// regardless of grouping, using a per-project, per-second Redis counter
+// (INCR + EXPIRE).
+type TokenBucketThrottler struct {
+	Cache         *Cache
+	RatePerSecond int64
+}
+
+func (t *TokenBucketThrottler) Throttle(req ThrottleRequest) (ThrottleDecision, error) {
+	if t.RatePerSecond <= 0 {
+		return ThrottleAllow, nil
+	}
+
+	key := fmt.Sprintf("tokenbucket:%d:%d", req.ProjectId, time.Now().Unix())
+
+	count, err := t.Cache.Get(key)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+	if count == 0 {
+		if err := t.Cache.Set(key, time.Second); err != nil {
+			return ThrottleAllow, err
+		}
+	}
+
+	count, err = t.Cache.Incr(key)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+
+	if count > t.RatePerSecond {
+		return ThrottleRateLimit, nil
+	}
+	return ThrottleAllow, nil
+}
+
+// ExponentialDecayThrottler lets every occurrence of a group through until
+// it crosses Threshold, after which only 1 in SampleRate occurrences are
+// forwarded (marked ThrottleSample) so a noisy group keeps a trickle of
+// signal instead of going fully silent.
+type ExponentialDecayThrottler struct {
+	Cache              *Cache
+	Threshold          int64
+	SampleRate         int64
+	UrlCacheExpiration time.Duration
+}
+
+func (t *ExponentialDecayThrottler) Throttle(req ThrottleRequest) (ThrottleDecision, error) {
+	if t.UrlCacheExpiration <= 0 || t.SampleRate <= 0 {
+		return ThrottleAllow, nil
+	}
+
+	count, err := t.Cache.Get(req.CacheKey)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+	if count == 0 {
+		if err := t.Cache.Set(req.CacheKey, t.UrlCacheExpiration); err != nil {
+			return ThrottleAllow, err
+		}
+	}
+
+	count, err = t.Cache.Incr(req.CacheKey)
+	if err != nil {
+		return ThrottleAllow, err
+	}
+
+	if count <= t.Threshold {
+		return ThrottleAllow, nil
+	}
+	if count%t.SampleRate == 0 {
+		return ThrottleSample, nil
+	}
+	return ThrottleIgnore, nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mkrysiak/cyclops-go/conf"
+)
+
+// NewThrottler builds the Throttler selected by cfg.ThrottleStrategy.
+func NewThrottler(cfg *conf.Config, cache *Cache) (Throttler, error) {
+	expiration := time.Duration(cfg.UrlCacheExpiration) * time.Second
+
+	switch ThrottleStrategy(cfg.ThrottleStrategy) {
+	case ThrottleStrategyTokenBucket:
+		return &TokenBucketThrottler{
+			Cache:         cache,
+			RatePerSecond: int64(cfg.TokenBucketRatePerSecond),
+		}, nil
+	case ThrottleStrategyExponentialDecay:
+		return &ExponentialDecayThrottler{
+			Cache:              cache,
+			Threshold:          int64(cfg.SampleThreshold),
+			SampleRate:         int64(cfg.SampleRate),
+			UrlCacheExpiration: expiration,
+		}, nil
+	case "", ThrottleStrategyFixedWindow:
+		return &FixedWindowThrottler{
+			Cache:              cache,
+			MaxUses:            int64(cfg.MaxCacheUses),
+			UrlCacheExpiration: expiration,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown throttle strategy %q", cfg.ThrottleStrategy)
+	}
+}